@@ -0,0 +1,188 @@
+package kite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"koding/newkite/protocol"
+	"log"
+	"net/rpc"
+	"reflect"
+	"strings"
+)
+
+// Principal, Authenticator and Authorizer are aliases of the protocol
+// package's types of the same name: protocol.Options needs to hold an
+// Authenticator/Authorizer without importing kite (which already imports
+// protocol), so the canonical definitions live there and kite re-exports
+// them under their original names.
+type (
+	Principal     = protocol.Principal
+	Authenticator = protocol.Authenticator
+	Authorizer    = protocol.Authorizer
+)
+
+// AuthError is returned by the auth codec wrapper on either an
+// authentication or authorization failure. It is a distinct type on the
+// serving side only: net/rpc sends just its Error() text to the caller, so
+// a client receives an rpc.ServerError starting with "kite: not authorized: "
+// and no client codec turns it back into an *AuthError.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return "kite: not authorized: " + e.Err.Error()
+}
+
+// AddFunctionWithACL registers rcvr under name like AddFunction, but also
+// declares that only principals holding one of roles may call its methods:
+// every method of rcvr is granted to roles, since ACLAuthorizer keys its
+// ACL by bare method name. It requires
+// k.Authorizer to be an *ACLAuthorizer; other Authorizer implementations
+// should be configured directly instead.
+func (k *Kite) AddFunctionWithACL(name string, rcvr interface{}, roles []string) {
+	k.AddFunction(name, rcvr)
+
+	acl, ok := k.Authorizer.(*ACLAuthorizer)
+	if !ok {
+		log.Printf("AddFunctionWithACL: %s has no *ACLAuthorizer configured, ACL for %q ignored\n", k.Kitename, name)
+		return
+	}
+	t := reflect.TypeOf(rcvr)
+	for i := 0; i < t.NumMethod(); i++ {
+		acl.Grant(t.Method(i).Name, roles...)
+	}
+}
+
+// ACLAuthorizer is a deny-by-default Authorizer backed by a static method ->
+// allowed-roles map, typically loaded from manifest.json.
+type ACLAuthorizer struct {
+	acl map[string][]string
+}
+
+// NewACLAuthorizer returns an authorizer with an empty ACL; every method is
+// denied until Grant is called for it.
+func NewACLAuthorizer() *ACLAuthorizer {
+	return &ACLAuthorizer{acl: make(map[string][]string)}
+}
+
+// LoadACL reads the "acl" section of a manifest.json file, shaped as
+// {"acl": {"methodName": ["role:admin"]}}.
+func LoadACL(path string) (*ACLAuthorizer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		ACL map[string][]string `json:"acl"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	a := NewACLAuthorizer()
+	for method, roles := range manifest.ACL {
+		a.acl[method] = roles
+	}
+	return a, nil
+}
+
+// Grant allows any principal holding one of roles to call method.
+func (a *ACLAuthorizer) Grant(method string, roles ...string) {
+	a.acl[method] = append(a.acl[method], roles...)
+}
+
+// Authorize implements Authorizer. A method with no ACL entry at all is
+// denied, matching the deny-by-default requirement.
+func (a *ACLAuthorizer) Authorize(p Principal, kitename, method string) error {
+	roles, ok := a.acl[method]
+	if !ok {
+		return fmt.Errorf("no ACL entry for method %q", method)
+	}
+	for _, role := range roles {
+		if p.HasRole(role) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not permitted to call %q", p.ID, method)
+}
+
+// wrapAuth wraps codec with authentication/authorization if the Kite has an
+// Authenticator configured. It is applied around every server codec
+// (NewKiteServerCodec, NewDnodeServerCodec, ...) so the check happens
+// regardless of transport/wire codec.
+func (k *Kite) wrapAuth(codec rpc.ServerCodec) rpc.ServerCodec {
+	if k.Authenticator == nil {
+		return codec
+	}
+	return &authServerCodec{ServerCodec: codec, k: k}
+}
+
+type authServerCodec struct {
+	rpc.ServerCodec
+	k             *Kite
+	serviceMethod string
+
+	// principalSet/principalVal carry the Principal ReadRequestBody just
+	// established, so the outer middlewareServerCodec (see wrapMiddleware)
+	// can read it back via principal() without re-running Authenticate.
+	principalSet bool
+	principalVal Principal
+}
+
+func (c *authServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.ServerCodec.ReadRequestHeader(r); err != nil {
+		return err
+	}
+	c.serviceMethod = r.ServiceMethod
+	return nil
+}
+
+func (c *authServerCodec) ReadRequestBody(body interface{}) error {
+	if err := c.ServerCodec.ReadRequestBody(body); err != nil {
+		return err
+	}
+	if body == nil {
+		return nil
+	}
+
+	req, ok := body.(*protocol.KiteRequest)
+	if !ok {
+		return nil
+	}
+
+	principal, err := c.k.Authenticator.Authenticate(req)
+	if err != nil {
+		return &AuthError{Err: err}
+	}
+	c.principalVal = principal
+	c.principalSet = true
+
+	if c.k.Authorizer != nil {
+		kitename, method := splitServiceMethod(c.serviceMethod)
+		if err := c.k.Authorizer.Authorize(principal, kitename, method); err != nil {
+			return &AuthError{Err: err}
+		}
+	}
+
+	return nil
+}
+
+// principal returns the Principal established by the ReadRequestBody call
+// for the request currently being read, and whether Authenticate has run at
+// all yet for this codec. Like serviceMethod, it is safe as a plain field
+// because net/rpc reads a single connection's requests one at a time.
+func (c *authServerCodec) principal() (Principal, bool) {
+	return c.principalVal, c.principalSet
+}
+
+// splitServiceMethod turns net/rpc's "Kitename.Method" into its two parts.
+func splitServiceMethod(serviceMethod string) (kitename, method string) {
+	i := strings.LastIndex(serviceMethod, ".")
+	if i < 0 {
+		return "", serviceMethod
+	}
+	return serviceMethod[:i], serviceMethod[i+1:]
+}
@@ -0,0 +1,38 @@
+package kite
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"koding/newkite/protocol"
+)
+
+// HMACAuthenticator authenticates callers by checking that req.Token is a
+// valid HMAC-SHA256 signature of the caller's identity, computed with a
+// secret shared out of band between the two kites.
+type HMACAuthenticator struct {
+	Secret []byte
+}
+
+// NewHMACAuthenticator returns an authenticator keyed with secret.
+func NewHMACAuthenticator(secret []byte) *HMACAuthenticator {
+	return &HMACAuthenticator{Secret: secret}
+}
+
+// Sign computes the token a caller should set on req.Token so that this
+// authenticator accepts it.
+func (a *HMACAuthenticator) Sign(username, kitename, uuid string) string {
+	mac := hmac.New(sha256.New, a.Secret)
+	mac.Write([]byte(username + ":" + kitename + ":" + uuid))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *HMACAuthenticator) Authenticate(req *protocol.KiteRequest) (Principal, error) {
+	expected := a.Sign(req.Username, req.Kitename, req.Uuid)
+	if !hmac.Equal([]byte(expected), []byte(req.Token)) {
+		return Principal{}, errors.New("hmac: invalid token")
+	}
+
+	return Principal{ID: req.Uuid, Roles: []string{"role:peer"}}, nil
+}
@@ -0,0 +1,66 @@
+package kite
+
+import (
+	"errors"
+	"fmt"
+	"koding/newkite/protocol"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// JWTAuthenticator authenticates callers by validating req.Token as an
+// RSA-signed JWT (RS256, RS384 or RS512) whose "uuid" claim matches
+// req.Uuid, verifying the signature against the single PublicKey it was
+// configured with, whichever kite the call comes from.
+type JWTAuthenticator struct {
+	PublicKey []byte // PEM-encoded RSA public key
+}
+
+// NewJWTAuthenticator returns an authenticator that verifies tokens against
+// publicKey, a PEM-encoded RSA public key. It errors early if publicKey does
+// not parse, so misconfiguration is caught at startup rather than on the
+// first incoming request.
+func NewJWTAuthenticator(publicKey []byte) (*JWTAuthenticator, error) {
+	if _, err := jwt.ParseRSAPublicKeyFromPEM(publicKey); err != nil {
+		return nil, err
+	}
+	return &JWTAuthenticator{PublicKey: publicKey}, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(req *protocol.KiteRequest) (Principal, error) {
+	key, err := jwt.ParseRSAPublicKeyFromPEM(a.PublicKey)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	token, err := jwt.Parse(req.Token, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("jwt: unexpected signing method %v", t.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil {
+		return Principal{}, fmt.Errorf("jwt: %s", err)
+	}
+	if !token.Valid {
+		return Principal{}, errors.New("jwt: invalid token")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+
+	uuid, _ := claims["uuid"].(string)
+	if uuid == "" || uuid != req.Uuid {
+		return Principal{}, errors.New("jwt: token uuid does not match request")
+	}
+
+	var roles []string
+	if claimed, ok := claims["roles"].([]interface{}); ok {
+		for _, r := range claimed {
+			if role, ok := r.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	return Principal{ID: uuid, Roles: roles}, nil
+}
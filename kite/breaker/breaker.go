@@ -0,0 +1,234 @@
+// Package breaker implements a simple per-peer circuit breaker so outbound
+// kite calls stop being sent to peers that are clearly unhealthy instead of
+// queuing up behind calls that are likely to fail or time out anyway.
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is one of Closed, Open or HalfOpen.
+type State int
+
+const (
+	// Closed is the normal state: calls are allowed and their outcomes
+	// recorded.
+	Closed State = iota
+	// Open rejects calls outright until Config.OpenTimeout has elapsed
+	// since the breaker tripped.
+	Open
+	// HalfOpen allows a single probe call through to decide whether the
+	// peer has recovered.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Config tunes how aggressively a Breaker trips and recovers.
+type Config struct {
+	// Window is how far back Record'ed outcomes are considered when
+	// evaluating the thresholds below.
+	Window time.Duration
+
+	// MinSamples is the minimum number of outcomes inside Window before
+	// the thresholds are evaluated at all, so one early failure doesn't
+	// trip the breaker.
+	MinSamples int
+
+	// ErrorRateThreshold trips the breaker once the fraction of failed
+	// calls in Window reaches this value, e.g. 0.5 for 50%.
+	ErrorRateThreshold float64
+
+	// LatencyThreshold trips the breaker once the average latency of
+	// calls in Window reaches this value.
+	LatencyThreshold time.Duration
+
+	// OpenTimeout is how long a tripped breaker stays Open before letting
+	// a single HalfOpen probe through.
+	OpenTimeout time.Duration
+}
+
+// DefaultConfig is a reasonable starting point for inter-kite calls.
+func DefaultConfig() Config {
+	return Config{
+		Window:             10 * time.Second,
+		MinSamples:         5,
+		ErrorRateThreshold: 0.5,
+		LatencyThreshold:   2 * time.Second,
+		OpenTimeout:        5 * time.Second,
+	}
+}
+
+type sample struct {
+	at      time.Time
+	failed  bool
+	latency time.Duration
+}
+
+// Breaker tracks the health of calls made to a single peer.
+type Breaker struct {
+	mu sync.Mutex
+
+	cfg   Config
+	state State
+
+	samples      []sample
+	openedAt     time.Time
+	halfOpenBusy bool
+}
+
+// New returns a Breaker in the Closed state, configured with cfg.
+func New(cfg Config) *Breaker {
+	return &Breaker{cfg: cfg, state: Closed}
+}
+
+// Allow reports whether a call may be attempted right now. An Open breaker
+// moves itself to HalfOpen and allows exactly one probe call once
+// Config.OpenTimeout has elapsed since it tripped.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		return true
+	case HalfOpen:
+		if b.halfOpenBusy {
+			return false
+		}
+		b.halfOpenBusy = true
+		return true
+	default: // Open
+		if time.Since(b.openedAt) < b.cfg.OpenTimeout {
+			return false
+		}
+		b.state = HalfOpen
+		b.halfOpenBusy = true
+		return true
+	}
+}
+
+// Record reports the outcome of a call previously admitted by Allow.
+func (b *Breaker) Record(err error, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.samples = evict(append(b.samples, sample{at: now, failed: err != nil, latency: latency}), now, b.cfg.Window)
+
+	if b.state == HalfOpen {
+		b.halfOpenBusy = false
+		if err != nil {
+			b.trip(now)
+		} else {
+			b.state = Closed
+			b.samples = nil
+		}
+		return
+	}
+
+	if b.state == Open || len(b.samples) < b.cfg.MinSamples {
+		return
+	}
+
+	var failures int
+	var totalLatency time.Duration
+	for _, s := range b.samples {
+		if s.failed {
+			failures++
+		}
+		totalLatency += s.latency
+	}
+
+	errorRate := float64(failures) / float64(len(b.samples))
+	avgLatency := totalLatency / time.Duration(len(b.samples))
+
+	if errorRate >= b.cfg.ErrorRateThreshold || (b.cfg.LatencyThreshold > 0 && avgLatency >= b.cfg.LatencyThreshold) {
+		b.trip(now)
+	}
+}
+
+// State reports the breaker's current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) trip(now time.Time) {
+	b.state = Open
+	b.openedAt = now
+	b.halfOpenBusy = false
+}
+
+// evict drops samples older than window, relative to now.
+func evict(samples []sample, now time.Time, window time.Duration) []sample {
+	cut := 0
+	for cut < len(samples) && now.Sub(samples[cut].at) > window {
+		cut++
+	}
+	return samples[cut:]
+}
+
+// Registry holds one Breaker per peer, keyed by the peer's Uuid, so
+// roundRobin-style selection can skip peers that are currently unhealthy.
+type Registry struct {
+	mu sync.Mutex
+
+	cfg      Config
+	breakers map[string]*Breaker
+}
+
+// NewRegistry returns an empty Registry; a peer gets its own Breaker, built
+// with cfg, the first time it is seen.
+func NewRegistry(cfg Config) *Registry {
+	return &Registry{cfg: cfg, breakers: make(map[string]*Breaker)}
+}
+
+func (r *Registry) get(uuid string) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[uuid]
+	if !ok {
+		b = New(r.cfg)
+		r.breakers[uuid] = b
+	}
+	return b
+}
+
+// Allow reports whether a call to the peer identified by uuid may proceed.
+func (r *Registry) Allow(uuid string) bool {
+	return r.get(uuid).Allow()
+}
+
+// Record reports the outcome of a call to the peer identified by uuid.
+func (r *Registry) Record(uuid string, err error, latency time.Duration) {
+	r.get(uuid).Record(err, latency)
+}
+
+// UpdateConfig changes the Config existing and future Breakers are
+// evaluated against, e.g. in response to a hot-reloaded limits update.
+func (r *Registry) UpdateConfig(cfg Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cfg = cfg
+	for _, b := range r.breakers {
+		b.mu.Lock()
+		b.cfg = cfg
+		b.mu.Unlock()
+	}
+}
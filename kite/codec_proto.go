@@ -0,0 +1,221 @@
+package kite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/rpc"
+
+	goproto "code.google.com/p/goprotobuf/proto"
+
+	"koding/newkite/kite/proto"
+	"koding/newkite/kite/transport"
+)
+
+// maxFrameSize bounds a single readFrame allocation. Frames larger than
+// this are rejected before the length-prefixed body is read, since the
+// prefix is attacker-controlled (it arrives before any auth/codec
+// validation) and a peer sending a length near math.MaxUint32 would
+// otherwise force a multi-GB allocation per frame.
+const maxFrameSize = 64 << 20 // 64MiB, comfortably above any real kite call/response
+
+// contentTypeProto and contentTypeGob are the two payload encodings the
+// Protobuf codec understands. A payload is only ever Protobuf-encoded when
+// the args/result value registered for the method implements proto.Message;
+// everything else falls back to gob so existing interface{}-based kite
+// methods keep working until protoc-gen-kite generates typed stubs for them.
+const (
+	contentTypeProto = "application/x-protobuf"
+	contentTypeGob   = "application/x-gob"
+)
+
+// writeFrame writes data to w as a 4-byte big-endian length prefix followed
+// by data itself.
+func writeFrame(w io.Writer, data []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads one length-prefixed frame written by writeFrame.
+func readFrame(r io.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("kite: proto codec: frame of %d bytes exceeds max %d", n, maxFrameSize)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// marshalPayload encodes body as Protobuf when possible, otherwise gob.
+func marshalPayload(body interface{}) (data []byte, contentType string, err error) {
+	if msg, ok := body.(goproto.Message); ok {
+		data, err = goproto.Marshal(msg)
+		return data, contentTypeProto, err
+	}
+
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(body)
+	return buf.Bytes(), contentTypeGob, err
+}
+
+// unmarshalPayload decodes data into body according to contentType.
+func unmarshalPayload(data []byte, contentType string, body interface{}) error {
+	if body == nil {
+		return nil
+	}
+
+	switch contentType {
+	case contentTypeProto:
+		msg, ok := body.(goproto.Message)
+		if !ok {
+			return fmt.Errorf("kite: proto codec: %T does not implement proto.Message", body)
+		}
+		return goproto.Unmarshal(data, msg)
+	case contentTypeGob:
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(body)
+	default:
+		return fmt.Errorf("kite: proto codec: unknown content-type %q", contentType)
+	}
+}
+
+// protoServerCodec implements rpc.ServerCodec on top of the Header/payload
+// framing documented in kite/proto/kite.proto.
+type protoServerCodec struct {
+	conn        transport.Conn
+	contentType string // content-type of the request currently being read
+}
+
+// NewProtoServerCodec returns an rpc.ServerCodec that speaks kite's
+// Protobuf wire format over conn. k is unused today but kept for symmetry
+// with the other NewXServerCodec constructors, which all take the owning
+// Kite so they can reach auth/transport state.
+func NewProtoServerCodec(k *Kite, conn transport.Conn) rpc.ServerCodec {
+	return &protoServerCodec{conn: conn}
+}
+
+func (c *protoServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	data, err := readFrame(c.conn)
+	if err != nil {
+		return err
+	}
+
+	var h proto.Header
+	if err := goproto.Unmarshal(data, &h); err != nil {
+		return err
+	}
+
+	r.ServiceMethod = h.GetServiceMethod()
+	r.Seq = h.GetSeq()
+	c.contentType = h.GetContentType()
+	return nil
+}
+
+func (c *protoServerCodec) ReadRequestBody(body interface{}) error {
+	data, err := readFrame(c.conn)
+	if err != nil {
+		return err
+	}
+	return unmarshalPayload(data, c.contentType, body)
+}
+
+func (c *protoServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	payload, contentType, err := marshalPayload(body)
+	if err != nil {
+		return err
+	}
+
+	h := &proto.Header{
+		ServiceMethod: &r.ServiceMethod,
+		Seq:           &r.Seq,
+		ContentType:   &contentType,
+		Error:         &r.Error,
+	}
+	data, err := goproto.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFrame(c.conn, data); err != nil {
+		return err
+	}
+	return writeFrame(c.conn, payload)
+}
+
+func (c *protoServerCodec) Close() error {
+	return c.conn.Close()
+}
+
+// protoClientCodec is the client-side counterpart of protoServerCodec.
+type protoClientCodec struct {
+	conn        transport.Conn
+	contentType string // content-type of the response currently being read
+}
+
+// NewProtoClientCodec returns an rpc.ClientCodec that speaks kite's
+// Protobuf wire format over conn.
+func NewProtoClientCodec(k *Kite, conn transport.Conn) rpc.ClientCodec {
+	return &protoClientCodec{conn: conn}
+}
+
+func (c *protoClientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	payload, contentType, err := marshalPayload(body)
+	if err != nil {
+		return err
+	}
+
+	h := &proto.Header{
+		ServiceMethod: &r.ServiceMethod,
+		Seq:           &r.Seq,
+		ContentType:   &contentType,
+	}
+	data, err := goproto.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFrame(c.conn, data); err != nil {
+		return err
+	}
+	return writeFrame(c.conn, payload)
+}
+
+func (c *protoClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	data, err := readFrame(c.conn)
+	if err != nil {
+		return err
+	}
+
+	var h proto.Header
+	if err := goproto.Unmarshal(data, &h); err != nil {
+		return err
+	}
+
+	r.ServiceMethod = h.GetServiceMethod()
+	r.Seq = h.GetSeq()
+	r.Error = h.GetError()
+	c.contentType = h.GetContentType()
+	return nil
+}
+
+func (c *protoClientCodec) ReadResponseBody(body interface{}) error {
+	data, err := readFrame(c.conn)
+	if err != nil {
+		return err
+	}
+	return unmarshalPayload(data, c.contentType, body)
+}
+
+func (c *protoClientCodec) Close() error {
+	return c.conn.Close()
+}
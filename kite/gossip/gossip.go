@@ -0,0 +1,417 @@
+// Package gossip implements a lightweight peer-to-peer membership protocol
+// that kites can use to discover and monitor each other without depending on
+// a central Kontrol server. It follows the pull-based anti-entropy approach
+// used by Hyperledger Fabric's gossip comm layer: on every tick a node picks
+// a handful of known peers, exchanges a digest of what it knows, and merges
+// in anything newer.
+package gossip
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Member represents what the gossip layer knows about a single kite.
+type Member struct {
+	Uuid           string
+	Kitename       string
+	Addr           string
+	HeartbeatTS    int64
+	IncarnationNum int
+
+	// Suspect is true once the member has missed SuspectAfter intervals of
+	// heartbeats. It is cleared as soon as a newer heartbeat is observed.
+	Suspect bool
+}
+
+// newer reports whether m is more recent than other, comparing the
+// incarnation number first and falling back to the heartbeat timestamp, the
+// same ordering Fabric's gossip uses to resolve conflicting membership
+// entries.
+func (m *Member) newer(other *Member) bool {
+	if m.IncarnationNum != other.IncarnationNum {
+		return m.IncarnationNum > other.IncarnationNum
+	}
+	return m.HeartbeatTS > other.HeartbeatTS
+}
+
+// DigestEntry is the minimal amount of information a node needs to decide
+// whether its peer is behind on a given member.
+type DigestEntry struct {
+	Uuid        string
+	HeartbeatTS int64
+}
+
+// digest is what gets sent in the "pull" request.
+type digest struct {
+	From    string
+	Entries []DigestEntry
+}
+
+// delta is the response to a digest: entries the responder has that are
+// newer than (or missing from) the requester's digest, plus the responder's
+// own digest. The requester does not answer that digest (mergeDigest is a
+// no-op), so only the requester merges anything in a round; the responder
+// learns nothing from it.
+type delta struct {
+	Members []Member
+	Request digest
+}
+
+// Config tunes the gossip subsystem. Zero values are replaced with sane
+// defaults by New.
+type Config struct {
+	// Interval is how often a pull round is initiated.
+	Interval time.Duration
+
+	// Fanout is the number of peers contacted per round.
+	Fanout int
+
+	// SuspectAfter is the number of missed intervals before a member is
+	// marked Suspect.
+	SuspectAfter int
+
+	// DeadAfter is the number of additional missed intervals, on top of
+	// SuspectAfter, before a Suspect member is declared dead and removed.
+	DeadAfter int
+
+	// DialTimeout bounds a single pull/push round trip.
+	DialTimeout time.Duration
+}
+
+func (c *Config) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = time.Second
+	}
+	if c.Fanout == 0 {
+		c.Fanout = 3
+	}
+	if c.SuspectAfter == 0 {
+		c.SuspectAfter = 3
+	}
+	if c.DeadAfter == 0 {
+		c.DeadAfter = 3
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = 2 * time.Second
+	}
+}
+
+// Gossiper maintains a membership view and exchanges it with random peers on
+// a fixed interval. It is safe for concurrent use.
+type Gossiper struct {
+	Config
+
+	mu   sync.RWMutex
+	view map[string]*Member // keyed by Uuid
+	self *Member
+
+	// OnUpdate is called whenever a member is added or refreshed.
+	OnUpdate func(m Member)
+
+	// OnRemove is called once a member is confirmed dead, so the caller can
+	// run it through the same removal path used for Kontrol-sourced removes.
+	OnRemove func(uuid string)
+
+	listener net.Listener
+	stopCh   chan struct{}
+}
+
+// New creates a Gossiper seeded with the local member and an initial list of
+// peer addresses to bootstrap the view from.
+func New(self Member, seeds []string, cfg Config) *Gossiper {
+	cfg.setDefaults()
+
+	g := &Gossiper{
+		Config: cfg,
+		view:   make(map[string]*Member),
+		self:   &self,
+		stopCh: make(chan struct{}),
+	}
+	g.view[self.Uuid] = &self
+
+	for _, addr := range seeds {
+		g.view[addr] = &Member{Addr: addr}
+	}
+
+	return g
+}
+
+// Start binds a listener for incoming pull requests and begins the periodic
+// gossip loop. It returns immediately; call Stop to shut it down.
+func (g *Gossiper) Start(addr string) error {
+	listener, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return err
+	}
+	g.listener = listener
+
+	go g.acceptLoop()
+	go g.gossipLoop()
+
+	return nil
+}
+
+// Stop terminates the gossip loop and closes the listener.
+func (g *Gossiper) Stop() {
+	close(g.stopCh)
+	if g.listener != nil {
+		g.listener.Close()
+	}
+}
+
+// SetIncarnation updates this node's own incarnation number, so a later
+// re-registration (e.g. after ReregisterRemediation) is gossiped as newer
+// than whatever peers last saw for this Uuid, the same way a higher
+// IncarnationNum already wins ties against a stale HeartbeatTS in newer.
+func (g *Gossiper) SetIncarnation(n int) {
+	g.mu.Lock()
+	g.self.IncarnationNum = n
+	g.mu.Unlock()
+}
+
+// Members returns a snapshot of the current membership view.
+func (g *Gossiper) Members() []Member {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	members := make([]Member, 0, len(g.view))
+	for _, m := range g.view {
+		members = append(members, *m)
+	}
+	return members
+}
+
+func (g *Gossiper) acceptLoop() {
+	for {
+		conn, err := g.listener.Accept()
+		if err != nil {
+			select {
+			case <-g.stopCh:
+				return
+			default:
+				log.Println("gossip: accept error:", err)
+				continue
+			}
+		}
+		go g.handleConn(conn)
+	}
+}
+
+// handleConn accepts a digest from whatever peer connected and answers it
+// with a delta; it merges nothing into the local view. There is no authentication on this path: any host that can
+// reach the gossip listener can claim an arbitrary {Uuid, Addr,
+// IncarnationNum} and have it merged into the view, from where it is dialed
+// for real by the owning Kite. This is a materially weaker trust model than
+// a Kontrol-only deployment and is a known limitation of the gossip
+// subsystem as it stands; gating merges behind a Kite's Authenticator would
+// need a handshake on this connection, which pullFrom/handleConn don't do
+// today.
+func (g *Gossiper) handleConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(g.DialTimeout))
+
+	var d digest
+	if err := json.NewDecoder(conn).Decode(&d); err != nil {
+		log.Println("gossip: decode digest:", err)
+		return
+	}
+
+	resp := delta{
+		Members: g.newerThan(d.Entries),
+		Request: g.localDigest(),
+	}
+	g.mergeDigest(d)
+
+	if err := json.NewEncoder(conn).Encode(&resp); err != nil {
+		log.Println("gossip: encode delta:", err)
+	}
+}
+
+func (g *Gossiper) gossipLoop() {
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stopCh:
+			return
+		case <-ticker.C:
+			g.heartbeatSelf()
+			g.pullRound()
+			g.detectFailures()
+		}
+	}
+}
+
+func (g *Gossiper) heartbeatSelf() {
+	g.mu.Lock()
+	g.self.HeartbeatTS = time.Now().Unix()
+	g.mu.Unlock()
+}
+
+// pullRound picks Fanout random peers (excluding self) and exchanges
+// digests with each of them.
+func (g *Gossiper) pullRound() {
+	for _, peer := range g.randomPeers(g.Fanout) {
+		go g.pullFrom(peer)
+	}
+}
+
+func (g *Gossiper) randomPeers(n int) []Member {
+	g.mu.RLock()
+	candidates := make([]Member, 0, len(g.view))
+	for _, m := range g.view {
+		if m.Uuid == g.self.Uuid || m.Addr == "" {
+			continue
+		}
+		candidates = append(candidates, *m)
+	}
+	g.mu.RUnlock()
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	return candidates[:n]
+}
+
+func (g *Gossiper) pullFrom(peer Member) {
+	conn, err := net.DialTimeout("tcp4", peer.Addr, g.DialTimeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(g.DialTimeout))
+
+	req := g.localDigest()
+	if err := json.NewEncoder(conn).Encode(&req); err != nil {
+		return
+	}
+
+	var resp delta
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return
+	}
+
+	for _, m := range resp.Members {
+		g.merge(m)
+	}
+	g.mergeDigest(resp.Request)
+}
+
+func (g *Gossiper) localDigest() digest {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	entries := make([]DigestEntry, 0, len(g.view))
+	for _, m := range g.view {
+		entries = append(entries, DigestEntry{Uuid: m.Uuid, HeartbeatTS: m.HeartbeatTS})
+	}
+	return digest{From: g.self.Uuid, Entries: entries}
+}
+
+// newerThan returns the members in the local view that are strictly more
+// recent than what's described in the peer's digest.
+func (g *Gossiper) newerThan(entries []DigestEntry) []Member {
+	known := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		known[e.Uuid] = e.HeartbeatTS
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var out []Member
+	for uuid, m := range g.view {
+		if ts, ok := known[uuid]; !ok || m.HeartbeatTS > ts {
+			out = append(out, *m)
+		}
+	}
+	return out
+}
+
+// mergeDigest records which entries the peer already has so a future round
+// doesn't resend them needlessly. It is currently a no-op placeholder for
+// digest bookkeeping beyond the immediate exchange.
+func (g *Gossiper) mergeDigest(d digest) {}
+
+func (g *Gossiper) merge(incoming Member) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	existing, ok := g.view[incoming.Uuid]
+	if !ok || incoming.newer(existing) {
+		m := incoming
+		m.Suspect = false
+		g.view[incoming.Uuid] = &m
+
+		// New bootstraps a placeholder Member{Addr: addr} keyed by the seed
+		// address itself, since the real Uuid isn't known yet. Now that
+		// we've learned the real entry for that Addr, drop the placeholder:
+		// its HeartbeatTS is permanently 0, so detectFailures never reaps
+		// it and it would otherwise linger forever as a phantom candidate
+		// in randomPeers.
+		if placeholder, ok := g.view[m.Addr]; ok && placeholder.Uuid == "" {
+			delete(g.view, m.Addr)
+		}
+
+		if g.OnUpdate != nil {
+			go g.OnUpdate(m)
+		}
+	}
+}
+
+// detectFailures scans the view for members that have gone quiet, marking
+// them Suspect and eventually evicting them via OnRemove.
+func (g *Gossiper) detectFailures() {
+	now := time.Now().Unix()
+	// Compute in duration arithmetic first and only convert to whole
+	// seconds at the end, rounding up: truncating a sub-second product to 0
+	// would mark every peer dead on the very next tick.
+	suspectAfter := int64((time.Duration(g.SuspectAfter)*g.Interval + time.Second - 1) / time.Second)
+	deadAfter := suspectAfter + int64((time.Duration(g.DeadAfter)*g.Interval+time.Second-1)/time.Second)
+
+	var dead []string
+
+	g.mu.Lock()
+	for uuid, m := range g.view {
+		if uuid == g.self.Uuid || m.HeartbeatTS == 0 {
+			continue
+		}
+		age := now - m.HeartbeatTS
+		switch {
+		case age > deadAfter:
+			dead = append(dead, uuid)
+			delete(g.view, uuid)
+		case age > suspectAfter:
+			m.Suspect = true
+		}
+	}
+	g.mu.Unlock()
+
+	for _, uuid := range dead {
+		if g.OnRemove != nil {
+			g.OnRemove(uuid)
+		}
+	}
+}
+
+// String renders the current view, handy for debug logging from the Kite.
+func (g *Gossiper) String() string {
+	var buf bytes.Buffer
+	for _, m := range g.Members() {
+		fmt.Fprintf(&buf, "%s(%s) hb=%d inc=%d suspect=%v\n",
+			m.Kitename, m.Addr, m.HeartbeatTS, m.IncarnationNum, m.Suspect)
+	}
+	return buf.String()
+}
@@ -0,0 +1,298 @@
+package kite
+
+import (
+	"errors"
+	"koding/db/models"
+	"koding/newkite/protocol"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// HealthCheckConfig tunes the outbound HealthCheck goroutine: how often it
+// probes peers, how long a single probe may take, and how many consecutive
+// failures before a peer is considered unhealthy.
+type HealthCheckConfig struct {
+	// Interval is how often every known peer is pinged.
+	Interval time.Duration
+
+	// Timeout bounds a single kite.Ping round trip.
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed pings before a
+	// peer is demoted and, on the next failure after that, removed.
+	FailureThreshold int
+}
+
+func (c *HealthCheckConfig) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = 5 * time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 2 * time.Second
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = 3
+	}
+}
+
+// HealthListener is notified whenever HealthCheck sees a peer cross the
+// healthy/unhealthy boundary, so operators can layer their own remediation
+// (paging, redeploying, ...) on top of the built-in demote-then-remove
+// behavior.
+type HealthListener func(peer *models.Kite, healthy bool)
+
+// pingService backs the built-in "kite" RPC service so HealthCheck has
+// something to call regardless of whatever methods a kite registered under
+// its own Kitename.
+type pingService struct{}
+
+// Ping always succeeds; HealthCheck only cares whether the round trip
+// completed within its configured timeout.
+func (pingService) Ping(args *protocol.KiteRequest, reply *string) error {
+	*reply = "pong"
+	return nil
+}
+
+// HealthCheck periodically pings every known peer named kitename via the
+// built-in kite.Ping RPC. A peer that misses cfg.FailureThreshold
+// consecutive pings is first marked unhealthy, and removed via kites.Remove
+// (as RemoveKite does) followed by SetPeers, the next time it is still
+// unreachable. Marking a peer unhealthy does not trip its breaker: each ping
+// is only recorded on it like any other call, so roundRobin skips the peer
+// only once those records reach the breaker's own thresholds.
+// HealthListener, if set, fires on every healthy<->unhealthy transition.
+// Start launches this automatically when HealthCheckConfig is configured
+// via protocol.Options; call it directly to additionally monitor other
+// kitenames.
+func (k *Kite) HealthCheck(kitename string, cfg HealthCheckConfig) {
+	cfg.setDefaults()
+
+	failures := make(map[string]int)
+	unhealthy := make(map[string]bool)
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, peer := range k.RemoteKites(kitename) {
+			start := time.Now()
+			err := k.pingPeer(peer, cfg.Timeout)
+			breakers.Record(peer.Uuid, err, time.Since(start))
+
+			if err == nil {
+				failures[peer.Uuid] = 0
+				if unhealthy[peer.Uuid] {
+					delete(unhealthy, peer.Uuid)
+					if k.HealthListener != nil {
+						k.HealthListener(peer, true)
+					}
+				}
+				continue
+			}
+
+			failures[peer.Uuid]++
+			if failures[peer.Uuid] < cfg.FailureThreshold {
+				continue
+			}
+
+			if !unhealthy[peer.Uuid] {
+				unhealthy[peer.Uuid] = true
+				if k.HealthListener != nil {
+					k.HealthListener(peer, false)
+				}
+				continue
+			}
+
+			debug("health check: removing unresponsive peer %s (%s)\n", peer.Kitename, peer.Uuid)
+			kites.Remove(peer.Uuid)
+			k.SetPeers(k.PeersAddr()...)
+			delete(failures, peer.Uuid)
+			delete(unhealthy, peer.Uuid)
+		}
+	}
+}
+
+// pingPeer calls the built-in kite.Ping RPC on peer, dialing it first if
+// this is the first call made to it.
+func (k *Kite) pingPeer(peer *models.Kite, timeout time.Duration) error {
+	if peer.Client == nil {
+		client, err := k.dialClient(peer)
+		if err != nil {
+			return err
+		}
+		peer.Client = client
+		kites.Add(peer)
+	}
+
+	var reply string
+	req := &protocol.KiteRequest{Base: protocol.Base{Uuid: k.Uuid}}
+	call := peer.Client.Go("kite.Ping", req, &reply, nil)
+
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(timeout):
+		return errors.New("kite: health check ping timed out")
+	}
+}
+
+// SelfWatchdogConfig tunes how the self-watchdog decides this kite is
+// partitioned and what it does about it.
+type SelfWatchdogConfig struct {
+	// Interval is how often the watchdog checks for recent activity.
+	Interval time.Duration
+
+	// MissedIntervals is how many Intervals of silence, on both Kontrol
+	// and gossip, before the watchdog considers itself partitioned.
+	MissedIntervals int
+
+	// Strategy runs once the watchdog declares a partition. One of
+	// ReregisterRemediation, RebindRemediation or ExitRemediation, or a
+	// caller-supplied func.
+	Strategy SelfRemediation
+}
+
+func (c *SelfWatchdogConfig) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.MissedIntervals == 0 {
+		c.MissedIntervals = 3
+	}
+	if c.Strategy == nil {
+		c.Strategy = ExitRemediation
+	}
+}
+
+// SelfRemediation is run by the self-watchdog once it believes this kite is
+// partitioned from both Kontrol and gossip.
+type SelfRemediation func(k *Kite)
+
+// ReregisterRemediation bumps the kite's incarnation number, pushes it into
+// the running gossip subsystem and re-registers to Kontrol, on the
+// assumption that Kontrol dropped this kite's registration rather than this
+// kite being truly unreachable. Bumping k.incarnation alone has no effect
+// on its own: it's RegisterToKontrol and Gossip.SetIncarnation that carry
+// it to Kontrol and gossip peers respectively.
+func ReregisterRemediation(k *Kite) {
+	k.incarnation++
+	if k.Gossip != nil {
+		k.Gossip.SetIncarnation(k.incarnation)
+	}
+	k.Registered = false
+	if err := k.RegisterToKontrol(); err != nil {
+		log.Println("self remediation: re-register failed:", err)
+	}
+}
+
+// RebindRemediation closes and re-opens the listener on the same address,
+// on the assumption the partition is local (a stuck socket, a dead NIC)
+// rather than an actual network split. The old listener is closed first so
+// the rebind doesn't fail with "address already in use" against a kite's
+// own still-open socket.
+func RebindRemediation(k *Kite) {
+	if k.listener != nil {
+		k.listener.Close()
+	}
+	k.OnceServer = sync.Once{}
+	k.readyCh = make(chan struct{})
+	go k.serve(k.Addr)
+}
+
+// ExitRemediation exits the process non-zero so an external supervisor
+// (systemd, a process manager, an orchestrator) restarts it. This is the
+// default Strategy, since it is the only one that is safe without knowing
+// anything about how this particular kite is deployed.
+func ExitRemediation(k *Kite) {
+	log.Printf("self remediation: %s appears partitioned, exiting for supervisor restart\n", k.Kitename)
+	os.Exit(1)
+}
+
+// selfWatchdog runs cfg.Strategy once this kite has seen no Kontrol
+// message and no gossip activity for cfg.MissedIntervals consecutive
+// checks, i.e. it can no longer tell whether it is still part of the
+// cluster.
+func (k *Kite) selfWatchdog(cfg SelfWatchdogConfig) {
+	cfg.setDefaults()
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	silence := cfg.Interval * time.Duration(cfg.MissedIntervals)
+
+	for range ticker.C {
+		if k.KontrolEnabled && time.Since(k.health.kontrolContact()) < silence {
+			continue
+		}
+		if k.Gossip != nil && time.Since(k.health.gossipActivity()) < silence {
+			continue
+		}
+
+		cfg.Strategy(k)
+		return
+	}
+}
+
+// healthState tracks the timestamps the self-watchdog and Healthy() reason
+// about. It is a separate, mutex-guarded type rather than plain fields on
+// Kite so those reads/writes don't need to share a lock with unrelated
+// Kite state.
+type healthState struct {
+	mu          sync.Mutex
+	lastKontrol time.Time
+	lastGossip  time.Time
+}
+
+func newHealthState() *healthState {
+	now := time.Now()
+	return &healthState{lastKontrol: now, lastGossip: now}
+}
+
+func (h *healthState) touchKontrol() {
+	h.mu.Lock()
+	h.lastKontrol = time.Now()
+	h.mu.Unlock()
+}
+
+func (h *healthState) touchGossip() {
+	h.mu.Lock()
+	h.lastGossip = time.Now()
+	h.mu.Unlock()
+}
+
+func (h *healthState) kontrolContact() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastKontrol
+}
+
+func (h *healthState) gossipActivity() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastGossip
+}
+
+// Healthy reports whether this kite currently considers itself part of the
+// cluster: registered to Kontrol (when enabled) and, when the self-watchdog
+// is running, still hearing from gossip.
+func (k *Kite) Healthy() bool {
+	if k.KontrolEnabled && !k.Registered {
+		return false
+	}
+	if k.Gossip != nil && k.SelfWatchdog != nil {
+		silence := k.SelfWatchdog.Interval * time.Duration(k.SelfWatchdog.MissedIntervals)
+		if time.Since(k.health.gossipActivity()) > silence {
+			return false
+		}
+	}
+	return true
+}
+
+// ServerReadyNotify returns a channel that is closed once serve has bound
+// its listener, so tests and callers can synchronize on startup instead of
+// polling or sleeping.
+func (k *Kite) ServerReadyNotify() <-chan struct{} {
+	return k.readyCh
+}
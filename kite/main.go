@@ -1,7 +1,6 @@
 package kite
 
 import (
-	"bufio"
 	"code.google.com/p/go.net/websocket"
 	"encoding/json"
 	"errors"
@@ -12,6 +11,9 @@ import (
 	"io"
 	"koding/db/models"
 	"koding/newkite/balancer"
+	"koding/newkite/kite/breaker"
+	"koding/newkite/kite/gossip"
+	"koding/newkite/kite/transport"
 	"koding/newkite/peers"
 	"koding/newkite/protocol"
 	"log"
@@ -31,6 +33,13 @@ var (
 	kites       = peers.New()
 	balance     = balancer.New()
 	permissions = goset.New()
+
+	// breakers tracks outbound call health per peer Uuid, so roundRobin can
+	// skip peers that are currently unhealthy instead of sending them
+	// doomed traffic. It lives next to balance for the same reason:
+	// round-robin selection and circuit breaking are both concerns of
+	// picking which peer a call actually goes to.
+	breakers = breaker.NewRegistry(breaker.DefaultConfig())
 )
 
 // Messenger is used to implement various Messaging patterns on top of the
@@ -74,7 +83,7 @@ we have FileSystem kite that expose the file system to a client.
 
 A Kite has several attributes:
 1. It's an RPC server with has (semi)support for codecs like:
-JSON-RPC, DNODE and GOB
+JSON-RPC, DNODE, GOB and Protobuf
 2. It's a GroupCache client and server, which enables distributed caching
 and data sharing amongst the peers it is connected.
 3. ZMQ messaging system, that allows to communicate with another ZMQ server.
@@ -87,18 +96,14 @@ Following should be done later or soon:
 1. Decide which functions of the Kite struct should be exported or not.
 2. Make Groupcache work, method templates are written but need modification
 and testing.
-3. Implement a pluggable AUTH mechanism.
-4. A better way to register functions to go's net/rpc. Something like:
+3. A better way to register functions to go's net/rpc. Something like:
 k.Register("methodName", func() error)
-5. MQ between peers. Kites should have Pub/Sub integrated that can message
+4. MQ between peers. Kites should have Pub/Sub integrated that can message
 with each other.
-6. Monitoring data of the HOST. Capture stats like CPU, Memory, Load.
-7. Limiter (or Firewall). Kite should have an Acess Control mechanism
-for incoming requests, for certain thresholds (like CPU, Memory), for certain
-kites, and so on.
-8. Tests, tests, tests... we need Unit tests, Benchmark tests, and many other
+5. Monitoring data of the HOST. Capture stats like CPU, Memory, Load.
+6. Tests, tests, tests... we need Unit tests, Benchmark tests, and many other
 things.
-9. Web Dashboard for controlling kites, starting them, stopping them and many
+7. Web Dashboard for controlling kites, starting them, stopping them and many
 other non-thinked things.
 */
 type Kite struct {
@@ -138,6 +143,100 @@ type Kite struct {
 	// by default yes, if disabled it bypasses kontrol
 	KontrolEnabled bool
 
+	// SeedAddrs is a list of "ip:port" addresses used to bootstrap the
+	// gossip membership view when KontrolEnabled is false. Kontrol-enabled
+	// kites may also set this to speed up convergence, in which case
+	// gossip runs alongside Kontrol rather than instead of it.
+	SeedAddrs []string
+
+	// GossipAddr is the address the gossip subsystem's own listener binds
+	// to, independent of Addr (the RPC/groupcache address). It defaults to
+	// ":0" (pick any free port): startGossip runs before serve binds Addr,
+	// so reusing Addr here would race serve for the same host:port and,
+	// for any kite configured with a fixed non-zero Port, always lose.
+	GossipAddr string
+
+	// Gossip is non-nil once the kite has started its gossip subsystem. It
+	// is the source of truth for peer discovery when KontrolEnabled is
+	// false, and a secondary source otherwise.
+	Gossip *gossip.Gossiper
+
+	// Transport determines how this Kite dials out to and listens for
+	// other kites. Defaults to transport.NewTCP() (the original HTTP
+	// CONNECT + GOB behavior) unless overridden via protocol.Options.
+	//
+	// Known limitation: unlike Codec, the chosen Transport is not announced
+	// to Kontrol/gossip and dialClient always dials out using this Kite's
+	// own Transport, never one matching what a given remote kite actually
+	// listens with. Every kite that needs to talk to every other kite must
+	// currently be configured with the same Transport; TLS, plain TCP and
+	// WebSocket kites cannot yet be mixed in one deployment.
+	Transport transport.Transport
+
+	// Codec selects the wire codec this Kite serves and announces to
+	// Kontrol at registration, e.g. protocol.CODEC_GOB (the default) or
+	// protocol.CODEC_PROTO. Remote kites read the announced value back off
+	// models.Kite.Codec and dial with the matching client codec.
+	Codec string
+
+	// Authenticator establishes the caller's identity for every incoming
+	// request. Nil (the default) disables authentication entirely, matching
+	// the original behavior.
+	Authenticator Authenticator
+
+	// Authorizer decides whether an authenticated caller may invoke a given
+	// method. Only consulted when Authenticator is also set.
+	Authorizer Authorizer
+
+	// Middlewares run, in order, on every incoming call before it is
+	// dispatched to the registered method. Built from RateLimiter,
+	// ConcurrencyLimiter and ResourceGuard below when protocol.Options
+	// requests them; append to it directly for anything else.
+	Middlewares []Middleware
+
+	// RateLimiter is this Kite's configured rate limiter, or nil if
+	// protocol.Options didn't request one. Kept alongside Middlewares so
+	// handle's "updateLimits" action can adjust it without a restart.
+	RateLimiter *RateLimiter
+
+	// ConcurrencyLimiter is this Kite's configured per-method concurrency
+	// limiter, or nil if protocol.Options didn't request one.
+	ConcurrencyLimiter *ConcurrencyLimiter
+
+	// ResourceGuard is this Kite's configured CPU/memory guard, or nil if
+	// protocol.Options didn't request one.
+	ResourceGuard *ResourceGuard
+
+	// HealthCheckConfig, if non-nil, causes Start to launch HealthCheck
+	// against k.Kitename's peers.
+	HealthCheckConfig *HealthCheckConfig
+
+	// HealthListener, if set, is notified of every healthy<->unhealthy
+	// transition HealthCheck observes.
+	HealthListener HealthListener
+
+	// SelfWatchdog, if non-nil, causes Start to launch selfWatchdog, and
+	// is also consulted by Healthy() to judge gossip staleness.
+	SelfWatchdog *SelfWatchdogConfig
+
+	// incarnation is bumped by ReregisterRemediation and sent as
+	// protocol.Base.Incarnation on the next RegisterToKontrol, and pushed
+	// into k.Gossip's own IncarnationNum via SetIncarnation, so Kontrol and
+	// gossip peers treat the re-registration as newer than whatever they
+	// last saw for this kite even if its HeartbeatTS hasn't advanced.
+	incarnation int
+
+	// health tracks when this kite last heard from Kontrol and from
+	// gossip, for Healthy() and the self-watchdog.
+	health *healthState
+
+	// readyCh is closed once serve has bound its listener.
+	readyCh chan struct{}
+
+	// listener is the transport.Listener serve bound addr to, kept so
+	// RebindRemediation can close it before rebinding the same address.
+	listener transport.Listener
+
 	// method map for shared methods
 	Methods map[string]string
 
@@ -195,28 +294,105 @@ func New(o *protocol.Options, rcvr interface{}, methods map[string]interface{})
 		port = "0" // binds to an automatic port
 	}
 
+	kiteTransport := o.Transport
+	if kiteTransport == nil {
+		kiteTransport = transport.NewTCP()
+	}
+
+	kiteCodec := o.Codec
+	if kiteCodec == "" {
+		kiteCodec = protocol.CODEC_GOB
+	}
+
+	var rateLimiter *RateLimiter
+	var concurrencyLimiter *ConcurrencyLimiter
+	var resourceGuard *ResourceGuard
+	var middlewares []Middleware
+
+	if o.RateLimitPerSecond > 0 {
+		rateLimiter = NewRateLimiter(o.RateLimitPerSecond, o.RateLimitBurst)
+		middlewares = append(middlewares, rateLimiter.Middleware)
+	}
+	if o.MaxConcurrentPerMethod > 0 {
+		concurrencyLimiter = NewConcurrencyLimiter(o.MaxConcurrentPerMethod)
+		middlewares = append(middlewares, concurrencyLimiter.Middleware)
+	}
+	if o.MaxCPUPercent > 0 || o.MaxMemPercent > 0 {
+		resourceGuard = NewResourceGuard(o.MaxCPUPercent, o.MaxMemPercent)
+		middlewares = append(middlewares, resourceGuard.Middleware)
+	}
+
+	if o.BreakerConfig != (breaker.Config{}) {
+		breakers.UpdateConfig(o.BreakerConfig)
+	}
+
+	var healthCheckConfig *HealthCheckConfig
+	if o.HealthCheckInterval > 0 || o.HealthCheckFailureThreshold > 0 {
+		healthCheckConfig = &HealthCheckConfig{
+			Interval:         o.HealthCheckInterval,
+			Timeout:          o.HealthCheckTimeout,
+			FailureThreshold: o.HealthCheckFailureThreshold,
+		}
+		healthCheckConfig.setDefaults()
+	}
+
+	// o.SelfRemediation is declared as interface{} on protocol.Options
+	// since protocol can't name the kite.SelfRemediation type (it takes a
+	// *Kite) without importing kite right back.
+	selfRemediation, _ := o.SelfRemediation.(SelfRemediation)
+
+	var selfWatchdog *SelfWatchdogConfig
+	if o.SelfWatchdogInterval > 0 {
+		selfWatchdog = &SelfWatchdogConfig{
+			Interval:        o.SelfWatchdogInterval,
+			MissedIntervals: o.SelfWatchdogMissedIntervals,
+			Strategy:        selfRemediation,
+		}
+		selfWatchdog.setDefaults()
+	}
+
+	// Same reasoning as o.SelfRemediation above, but for *models.Kite.
+	healthListener, _ := o.HealthListener.(HealthListener)
+
 	// print dependencies
 	// pwd, _ := os.Getwd()
 	// getDeps(pwd, o.Kitename)
 
 	k := &Kite{
-		Username:       o.Username,
-		Kitename:       o.Username + "/" + o.Kitename,
-		Version:        o.Version,
-		Uuid:           kiteID,
-		PublicKey:      publicKey,
-		Addr:           localIP + ":" + port,
-		PublicIP:       publicIP,
-		LocalIP:        localIP,
-		Port:           port,
-		Hostname:       hostname,
-		Server:         rpc.NewServer(),
-		KontrolEnabled: true,
-		Methods:        createMethodMap(o.Kitename, rcvr, methods),
-		Messenger:      NewZeroMQ(kiteID, o.Kitename, "all"),
-		Clients:        NewClients(),
+		Username:           o.Username,
+		Kitename:           o.Username + "/" + o.Kitename,
+		Version:            o.Version,
+		Uuid:               kiteID,
+		PublicKey:          publicKey,
+		Addr:               localIP + ":" + port,
+		PublicIP:           publicIP,
+		LocalIP:            localIP,
+		Port:               port,
+		Hostname:           hostname,
+		Server:             rpc.NewServer(),
+		KontrolEnabled:     true,
+		SeedAddrs:          o.SeedAddrs,
+		GossipAddr:         o.GossipAddr,
+		Transport:          kiteTransport,
+		Codec:              kiteCodec,
+		Authenticator:      o.Authenticator,
+		Authorizer:         o.Authorizer,
+		Middlewares:        middlewares,
+		RateLimiter:        rateLimiter,
+		ConcurrencyLimiter: concurrencyLimiter,
+		ResourceGuard:      resourceGuard,
+		HealthCheckConfig:  healthCheckConfig,
+		HealthListener:     healthListener,
+		SelfWatchdog:       selfWatchdog,
+		health:             newHealthState(),
+		readyCh:            make(chan struct{}),
+		Methods:            createMethodMap(o.Kitename, rcvr, methods),
+		Messenger:          NewZeroMQ(kiteID, o.Kitename, "all"),
+		Clients:            NewClients(),
 	}
 
+	k.Server.RegisterName("kite", pingService{})
+
 	if rcvr != nil {
 		k.AddFunction(o.Kitename, rcvr)
 	}
@@ -232,6 +408,15 @@ func (k *Kite) Start() {
 	// filter:msg, where msg is in format JSON  of PubResponse protocol format.
 	// Latter is important to ensure robustness, if not we have to unmarshal or
 	// check every incoming message.
+	k.startGossip()
+
+	if k.HealthCheckConfig != nil {
+		go k.HealthCheck(k.Kitename, *k.HealthCheckConfig)
+	}
+	if k.SelfWatchdog != nil {
+		go k.selfWatchdog(*k.SelfWatchdog)
+	}
+
 	if !k.KontrolEnabled {
 		k.Registered = true
 		k.serve(k.Addr)
@@ -241,6 +426,71 @@ func (k *Kite) Start() {
 	}
 }
 
+// startGossip sets up the gossip subsystem using SeedAddrs as the bootstrap
+// list. When KontrolEnabled is false this is the only way peers are
+// discovered; when it is true, gossip runs alongside Kontrol so that
+// PeersAddr/SetPeers stay consistent even if a Kontrol message is dropped.
+func (k *Kite) startGossip() {
+	self := gossip.Member{
+		Uuid:        k.Uuid,
+		Kitename:    k.Kitename,
+		Addr:        k.Addr,
+		HeartbeatTS: time.Now().Unix(),
+	}
+
+	k.Gossip = gossip.New(self, k.SeedAddrs, gossip.Config{})
+	k.Gossip.OnUpdate = k.onGossipUpdate
+	k.Gossip.OnRemove = k.onGossipRemove
+
+	gossipAddr := k.GossipAddr
+	if gossipAddr == "" {
+		// Always independent of Addr: serve() binds Addr later (and to a
+		// fixed, non-zero port for any static deployment), so reusing it
+		// here would make gossip race serve for the same host:port.
+		gossipAddr = ":0"
+	}
+
+	if err := k.Gossip.Start(gossipAddr); err != nil {
+		log.Println("gossip: could not start:", err)
+	}
+}
+
+// onGossipUpdate is invoked whenever the gossip view learns about a new or
+// refreshed peer. It feeds the same peers store that Kontrol-driven AddKite
+// uses, so groupcache peering stays consistent regardless of discovery
+// source.
+//
+// heartbeatSelf bumps every live peer's HeartbeatTS on essentially every
+// gossip round, so this fires far more often than an actual membership
+// change. Reusing the existing *models.Kite (if any) instead of building a
+// fresh one is what keeps that from dropping the peer's cached rpc.Client
+// and forcing a redial on every tick.
+func (k *Kite) onGossipUpdate(m gossip.Member) {
+	k.health.touchGossip()
+
+	if m.Uuid == "" || m.Uuid == k.Uuid {
+		return
+	}
+
+	kite := findKiteByUuid(m.Uuid)
+	if kite == nil {
+		kite = &models.Kite{}
+	}
+	kite.Kitename = m.Kitename
+	kite.Uuid = m.Uuid
+	kite.Addr = m.Addr
+
+	kites.Add(kite)
+	k.SetPeers(k.PeersAddr()...)
+}
+
+// onGossipRemove mirrors RemoveKite for peers declared dead by the gossip
+// failure detector.
+func (k *Kite) onGossipRemove(uuid string) {
+	kites.Remove(uuid)
+	k.SetPeers(k.PeersAddr()...)
+}
+
 // handle is a method that interprets the incoming message from Kontrol. The
 // incoming message is in form of protocol.PubResponse.
 func (k *Kite) handle(msg []byte) {
@@ -251,6 +501,8 @@ func (k *Kite) handle(msg []byte) {
 		return
 	}
 
+	k.health.touchKontrol()
+
 	// treat any incoming data as a ping, don't just rely on ping command
 	// this makes the kite more robust if we can't catch one of the pings.
 	k.Pong()
@@ -262,6 +514,10 @@ func (k *Kite) handle(msg []byte) {
 		k.RemoveKite(r)
 	case protocol.UpdateKite:
 		k.Registered = false //trigger reinitialization
+	case "updateLimits":
+		// Lets operators push new rate/concurrency/resource/breaker
+		// thresholds without restarting the kite.
+		k.UpdateLimits(r)
 	case "ping":
 		// This is needed for Node Coordination, that means we register ourself
 		// only if we got an "hello" from one of the kontrol servers. This is
@@ -290,6 +546,7 @@ func (k *Kite) AddKite(r protocol.PubResponse) {
 			Uuid:     r.Uuid,
 			Hostname: r.Hostname,
 			Addr:     r.Addr,
+			Codec:    r.Codec,
 		},
 	}
 
@@ -362,10 +619,12 @@ func (k *Kite) RegisterToKontrol() error {
 			PublicKey: k.PublicKey,
 			Hostname:  k.Hostname,
 			// Addr:      k.PublicIP + ":" + k.Port,
-			Addr:     k.Addr,
-			LocalIP:  k.LocalIP,
-			PublicIP: k.PublicIP,
-			Port:     k.Port,
+			Addr:        k.Addr,
+			LocalIP:     k.LocalIP,
+			PublicIP:    k.PublicIP,
+			Port:        k.Port,
+			Codec:       k.Codec,
+			Incarnation: k.incarnation,
 		},
 		Action: "register",
 	}
@@ -402,43 +661,42 @@ RPC
 
 ******************************************/
 
-// Can connect to RPC service using HTTP CONNECT to rpcPath.
+// connected is the status line the server side writes back to a client that
+// hijacked the connection via HTTP CONNECT.
 var connected = "200 Connected to Go RPC"
 
-// dialClient is used to connect to a Remote Kite via the GOB codec. This is
-// used by other external kite methods.
+// dialClient is used to connect to a Remote Kite. This is used by other
+// external kite methods. It is transport-agnostic in the sense that the
+// wire connection (TCP+CONNECT, TLS, WebSocket, ...) comes from k.Transport
+// rather than being hard-coded; it is always this Kite's own configured
+// Transport, not one matched to what kite actually listens with (see the
+// limitation noted on the Kite.Transport field). The wire codec (GOB,
+// Protobuf, ...) is picked per-call from kite.Codec, the value the remote
+// kite announced at registration, so a single process can talk to peers
+// running different codecs.
 func (k *Kite) dialClient(kite *models.Kite) (*rpc.Client, error) {
-	debug("establishing HTTP client conn for %s - %s on %s\n", kite.Kitename, kite.Addr, kite.Hostname)
-	var err error
-	conn, err := net.Dial("tcp4", kite.Addr)
+	debug("establishing %s client conn for %s - %s on %s\n", k.Transport.Name(), kite.Kitename, kite.Addr, kite.Hostname)
+
+	conn, err := k.Transport.Dial(kite.Addr)
 	if err != nil {
 		return nil, err
 	}
-	io.WriteString(conn, "CONNECT "+rpc.DefaultRPCPath+" HTTP/1.0\n\n")
 
-	// Require successful HTTP response
-	// before switching to RPC protocol.
-	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
-	if err == nil && resp.Status == connected {
-		c := NewKiteClientCodec(k, conn) // pass our custom codec
-		return rpc.NewClientWithCodec(c), nil
-	}
-	if err == nil {
-		err = errors.New("unexpected HTTP response: " + resp.Status)
-	}
-	conn.Close()
-	return nil, &net.OpError{
-		Op:   "dial-http",
-		Net:  "tcp " + kite.Addr,
-		Addr: nil,
-		Err:  err,
+	var c rpc.ClientCodec
+	switch kite.Codec {
+	case protocol.CODEC_PROTO:
+		c = NewProtoClientCodec(k, conn)
+	default:
+		c = NewKiteClientCodec(k, conn) // pass our custom codec
 	}
+
+	return rpc.NewClientWithCodec(c), nil
 }
 
 // serve starts our rpc server with the given addr. Addr should be in form of
 // "ip:port"
 func (k *Kite) serve(addr string) {
-	listener, err := net.Listen("tcp4", addr)
+	listener, err := k.Transport.Listen(addr)
 	if err != nil {
 		log.Println("PANIC!!!!! RPC SERVER COULD NOT INITIALIZED:", err)
 		os.Exit(1)
@@ -446,14 +704,71 @@ func (k *Kite) serve(addr string) {
 	}
 
 	k.Addr = listener.Addr().String()
+	k.listener = listener
 	fmt.Println("serve addr is", k.Addr)
+	close(k.readyCh)
 
 	// GroupCache
 	k.NewPool(k.Addr)
 	k.NewGroup()
 
 	k.Server.HandleHTTP(rpc.DefaultRPCPath, rpc.DefaultDebugPath)
-	http.Serve(listener, k)
+
+	if k.Transport.Name() == "websocket" {
+		// The WebSocket transport already performs its own HTTP upgrade
+		// internally, so accepted connections are ready for the codec
+		// directly; running them through http.Serve/ServeHTTP again would
+		// try to reparse an already-upgraded stream as a fresh HTTP
+		// request.
+		k.acceptLoop(listener)
+		return
+	}
+
+	http.Serve(transportListener{listener}, k)
+}
+
+// acceptLoop serves codec connections for transports that hand back
+// connections which are already past any HTTP upgrade (currently just
+// WebSocket).
+func (k *Kite) acceptLoop(listener transport.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println("kite: accept error:", err)
+			return
+		}
+		go k.Server.ServeCodec(k.wrapMiddleware(k.wrapAuth(k.serverCodec(conn))))
+	}
+}
+
+// serverCodec picks the ServerCodec to wrap conn with, according to k.Codec
+// (the value this Kite announced to Kontrol at registration).
+func (k *Kite) serverCodec(conn transport.Conn) rpc.ServerCodec {
+	switch k.Codec {
+	case protocol.CODEC_PROTO:
+		return NewProtoServerCodec(k, conn)
+	default:
+		return NewKiteServerCodec(k, conn)
+	}
+}
+
+// transportListener adapts a transport.Listener to net.Listener so it can be
+// handed to http.Serve. The underlying Conn values are always genuine
+// net.Conn implementations (net.Conn, *tls.Conn or *websocket.Conn).
+type transportListener struct {
+	transport.Listener
+}
+
+func (l transportListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	nc, ok := conn.(net.Conn)
+	if !ok {
+		return nil, errors.New("transport: connection does not implement net.Conn")
+	}
+	return nc, nil
 }
 
 // ServeHTTP interface for http package.
@@ -479,7 +794,7 @@ func (k *Kite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
-	k.Server.ServeCodec(NewKiteServerCodec(k, conn))
+	k.Server.ServeCodec(k.wrapMiddleware(k.wrapAuth(k.serverCodec(conn))))
 
 }
 
@@ -492,7 +807,7 @@ func (k *Kite) serveWS(ws *websocket.Conn) {
 	k.Clients.Add(&client{Conn: ws, Addr: addr})
 
 	// k.Server.ServeCodec(NewJsonServerCodec(k, ws))
-	k.Server.ServeCodec(NewDnodeServerCodec(k, ws))
+	k.Server.ServeCodec(k.wrapMiddleware(k.wrapAuth(NewDnodeServerCodec(k, ws))))
 }
 
 // AddFunction is used to add new structs with exposed methods with a different
@@ -511,7 +826,9 @@ func (k *Kite) CallSync(kite, method string, args interface{}, result interface{
 	}
 
 	rpcFunc := kite + "." + method
+	start := time.Now()
 	err = remoteKite.Client.Call(rpcFunc, args, result)
+	breakers.Record(remoteKite.Uuid, err, time.Since(start))
 	if err != nil {
 		log.Println(err)
 		return fmt.Errorf("[%s] call error: %s", kite, err.Error())
@@ -574,6 +891,11 @@ func (k *Kite) Call(kite, method string, args interface{}, fn func(err error, re
 		case <-runCall:
 			var result string
 
+			origin := protocol.ORIGIN_GOB
+			if remoteKite.Codec == protocol.CODEC_PROTO {
+				origin = protocol.ORIGIN_PROTO
+			}
+
 			a := &protocol.KiteRequest{
 				Base: protocol.Base{
 					Username: k.Username,
@@ -584,15 +906,18 @@ func (k *Kite) Call(kite, method string, args interface{}, fn func(err error, re
 					Hostname: k.Hostname,
 				},
 				Args:   args,
-				Origin: protocol.ORIGIN_GOB,
+				Origin: origin,
 			}
 
+			start := time.Now()
 			d := remoteKite.Client.Go(rpcFunc, a, &result, nil)
 
 			select {
 			case <-d.Done:
+				breakers.Record(remoteKite.Uuid, d.Error, time.Since(start))
 				fn(d.Error, result)
 			case <-time.Tick(10 * time.Second):
+				breakers.Record(remoteKite.Uuid, errors.New("kite: call timed out"), time.Since(start))
 				fn(d.Error, result)
 			}
 			return d
@@ -609,9 +934,16 @@ func (k *Kite) getRemoteKite(kite string) (*models.Kite, error) {
 	}
 
 	if r.Client == nil {
-		var err error
+		start := time.Now()
 		r.Client, err = k.dialClient(r)
 		if err != nil {
+			// roundRobin only returned r because breakers.Allow(r.Uuid)
+			// let it through, which for an Open/HalfOpen breaker also
+			// marks it busy. Nothing else on this path calls Record, so
+			// without this a dial failure here would leave a HalfOpen
+			// breaker permanently busy and the peer permanently excluded
+			// from roundRobin.
+			breakers.Record(r.Uuid, err, time.Since(start))
 			return nil, err
 		}
 		kites.Add(r)
@@ -628,11 +960,22 @@ func (k *Kite) roundRobin(kite string) (*models.Kite, error) {
 		return nil, fmt.Errorf("kite %s does not exist", kite)
 	}
 
-	index := balance.GetIndex(kite)
-	N := float64(lenOfKites)
-	n := int(math.Mod(float64(index+1), N))
-	balance.AddOrUpdateIndex(kite, n)
-	return remoteKites[n], nil
+	// Try every kite at most once, skipping ones whose breaker is open so
+	// we don't keep sending doomed traffic to a peer we already know is
+	// unhealthy.
+	for i := 0; i < lenOfKites; i++ {
+		index := balance.GetIndex(kite)
+		N := float64(lenOfKites)
+		n := int(math.Mod(float64(index+1), N))
+		balance.AddOrUpdateIndex(kite, n)
+
+		candidate := remoteKites[n]
+		if breakers.Allow(candidate.Uuid) {
+			return candidate, nil
+		}
+	}
+
+	return nil, fmt.Errorf("kite %s has no healthy peers", kite)
 }
 
 func (k *Kite) RemoteKites(kite string) []*models.Kite {
@@ -648,6 +991,20 @@ func (k *Kite) RemoteKites(kite string) []*models.Kite {
 	return remoteKites
 }
 
+// findKiteByUuid returns the already-known peer with the given Uuid, or nil
+// if kites has no entry for it yet. Callers that learn new attributes for a
+// peer (e.g. onGossipUpdate) use this to update the existing entry in place
+// instead of replacing it and losing whatever it already held, such as a
+// dialed rpc.Client.
+func findKiteByUuid(uuid string) *models.Kite {
+	for _, r := range kites.List() {
+		if r.Uuid == uuid {
+			return r
+		}
+	}
+	return nil
+}
+
 /******************************************
 
 GroupCache
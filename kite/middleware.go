@@ -0,0 +1,192 @@
+package kite
+
+import (
+	"koding/newkite/kite/breaker"
+	"koding/newkite/protocol"
+	"net/rpc"
+	"sync"
+)
+
+// CallContext carries the per-call state available to Middleware.
+type CallContext struct {
+	Kite *Kite
+
+	Kitename      string
+	Method        string
+	ServiceMethod string
+	CallerUuid    string
+
+	// Principal is what k.Authenticator established about the caller, or
+	// nil if no Authenticator is configured. CallerUuid is taken straight
+	// off the wire and unauthenticated even when Principal is set;
+	// middleware that needs to trust the caller's identity (e.g.
+	// RateLimiter keying its bucket) should prefer Principal.ID when it is
+	// non-nil.
+	Principal *Principal
+
+	onDone []func()
+}
+
+// OnDone registers fn to run once this call's response has been written.
+// Middleware that acquires some resource during admission (a rate-limit
+// token, a concurrency slot, ...) should release it here rather than right
+// after calling next, since next returning does not mean the registered
+// method has run yet: ReadRequestBody only decides whether to admit the
+// call, net/rpc dispatches it afterwards.
+func (ctx *CallContext) OnDone(fn func()) {
+	ctx.onDone = append(ctx.onDone, fn)
+}
+
+// Handler is the terminal step of a middleware chain.
+type Handler func(ctx *CallContext) error
+
+// Middleware wraps a Handler with cross-cutting admission logic (rate
+// limiting, circuit breaking, resource checks, ...). Well-behaved
+// middleware calls next exactly once when the call should proceed, and
+// returns an error without calling next to reject it.
+type Middleware func(ctx *CallContext, next Handler) error
+
+// chain builds a single Handler out of mws, terminating in a no-op handler:
+// there is no business logic to call into here, admission either succeeds
+// (net/rpc goes on to dispatch the method) or it doesn't.
+func chain(mws []Middleware) Handler {
+	h := Handler(func(ctx *CallContext) error { return nil })
+	for i := len(mws) - 1; i >= 0; i-- {
+		mw, next := mws[i], h
+		h = func(ctx *CallContext) error { return mw(ctx, next) }
+	}
+	return h
+}
+
+// wrapMiddleware wraps codec so every request runs through k.Middlewares
+// before being dispatched to the registered method.
+func (k *Kite) wrapMiddleware(codec rpc.ServerCodec) rpc.ServerCodec {
+	if len(k.Middlewares) == 0 {
+		return codec
+	}
+	return &middlewareServerCodec{ServerCodec: codec, k: k, pending: make(map[uint64]*CallContext)}
+}
+
+// UpdateLimits hot-updates the rate limiter, concurrency limiter, resource
+// guard and outbound circuit breaker from a Kontrol-pushed
+// protocol.PubResponse, so limits can be retuned without restarting the
+// kite. Only the limiters this Kite was constructed with are touched; a
+// zero value in r leaves the corresponding limit unchanged.
+func (k *Kite) UpdateLimits(r protocol.PubResponse) {
+	if k.RateLimiter != nil && r.RateLimitPerSecond > 0 {
+		burst := r.RateLimitBurst
+		if burst == 0 {
+			k.RateLimiter.mu.Lock()
+			burst = k.RateLimiter.Burst
+			k.RateLimiter.mu.Unlock()
+		}
+		k.RateLimiter.UpdateLimits(r.RateLimitPerSecond, burst)
+	}
+	if k.ConcurrencyLimiter != nil && r.MaxConcurrentPerMethod > 0 {
+		k.ConcurrencyLimiter.UpdateLimit(r.MaxConcurrentPerMethod)
+	}
+	if g := k.ResourceGuard; g != nil {
+		g.mu.Lock()
+		if r.MaxCPUPercent > 0 {
+			g.maxCPUPercent = r.MaxCPUPercent
+		}
+		if r.MaxMemPercent > 0 {
+			g.maxMemPercent = r.MaxMemPercent
+		}
+		g.mu.Unlock()
+	}
+	if r.BreakerConfig != (breaker.Config{}) {
+		breakers.UpdateConfig(r.BreakerConfig)
+	}
+}
+
+// middlewareServerCodec runs k.Middlewares in ReadRequestBody, gating
+// dispatch, and fires each admitted CallContext's OnDone callbacks from
+// WriteResponse, the only net/rpc hook that fires once the method has
+// actually returned.
+type middlewareServerCodec struct {
+	rpc.ServerCodec
+	k             *Kite
+	serviceMethod string
+	seq           uint64
+
+	mu      sync.Mutex
+	pending map[uint64]*CallContext
+}
+
+func (c *middlewareServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.ServerCodec.ReadRequestHeader(r); err != nil {
+		return err
+	}
+	c.serviceMethod = r.ServiceMethod
+	c.seq = r.Seq
+	return nil
+}
+
+func (c *middlewareServerCodec) ReadRequestBody(body interface{}) error {
+	if err := c.ServerCodec.ReadRequestBody(body); err != nil {
+		return err
+	}
+	if body == nil {
+		return nil
+	}
+
+	req, ok := body.(*protocol.KiteRequest)
+	if !ok {
+		return nil
+	}
+
+	kitename, method := splitServiceMethod(c.serviceMethod)
+	ctx := &CallContext{
+		Kite:          c.k,
+		Kitename:      kitename,
+		Method:        method,
+		ServiceMethod: c.serviceMethod,
+		CallerUuid:    req.Uuid,
+	}
+
+	// Wrapping order (see wrapMiddleware's caller) always puts wrapAuth
+	// inside wrapMiddleware, so c.ServerCodec has already run
+	// authServerCodec.ReadRequestBody for this same call by the time we get
+	// here; surface the Principal it established rather than leaving
+	// middleware stuck with the unauthenticated CallerUuid.
+	if ac, ok := c.ServerCodec.(*authServerCodec); ok {
+		if p, ok := ac.principal(); ok {
+			ctx.Principal = &p
+		}
+	}
+
+	if err := chain(c.k.Middlewares)(ctx); err != nil {
+		// A later middleware rejected the call after an earlier one in
+		// the same chain already admitted it (e.g. ConcurrencyLimiter
+		// acquired a slot, then ResourceGuard rejected). ctx never makes
+		// it into pending, so WriteResponse will never run these, and
+		// whatever was acquired would otherwise leak forever.
+		for _, fn := range ctx.onDone {
+			fn()
+		}
+		return err
+	}
+
+	c.mu.Lock()
+	c.pending[c.seq] = ctx
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *middlewareServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	ctx, ok := c.pending[r.Seq]
+	if ok {
+		delete(c.pending, r.Seq)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		for _, fn := range ctx.onDone {
+			fn()
+		}
+	}
+
+	return c.ServerCodec.WriteResponse(r, body)
+}
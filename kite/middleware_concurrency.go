@@ -0,0 +1,54 @@
+package kite
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrTooManyConcurrentCalls is returned when a method already has
+// MaxConcurrent calls in flight.
+var ErrTooManyConcurrentCalls = errors.New("kite: too many concurrent calls")
+
+// ConcurrencyLimiter bounds how many calls to a single method may be in
+// flight at once, independent of caller.
+type ConcurrencyLimiter struct {
+	MaxConcurrent int
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+// NewConcurrencyLimiter returns a limiter allowing up to maxConcurrent
+// in-flight calls per method.
+func NewConcurrencyLimiter(maxConcurrent int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{MaxConcurrent: maxConcurrent, inFlight: make(map[string]int)}
+}
+
+// UpdateLimit changes MaxConcurrent. Calls already in flight are unaffected;
+// the new limit only applies to admission decisions made after it is set.
+func (c *ConcurrencyLimiter) UpdateLimit(maxConcurrent int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.MaxConcurrent = maxConcurrent
+}
+
+// Middleware enforces c, keyed by ctx.Method. The slot acquired here is
+// released from ctx.OnDone, once the registered method has actually
+// returned, not when next itself returns.
+func (c *ConcurrencyLimiter) Middleware(ctx *CallContext, next Handler) error {
+	c.mu.Lock()
+	if c.inFlight[ctx.Method] >= c.MaxConcurrent {
+		c.mu.Unlock()
+		return ErrTooManyConcurrentCalls
+	}
+	c.inFlight[ctx.Method]++
+	c.mu.Unlock()
+
+	ctx.OnDone(func() {
+		c.mu.Lock()
+		c.inFlight[ctx.Method]--
+		c.mu.Unlock()
+	})
+
+	return next(ctx)
+}
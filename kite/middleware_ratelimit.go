@@ -0,0 +1,113 @@
+package kite
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a caller has exceeded its allotted rate
+// for a method.
+var ErrRateLimited = errors.New("kite: rate limit exceeded")
+
+// bucketIdleTTL is how long a bucket can go untouched before sweep collects
+// it. It's a generous multiple of any reasonable refill window so a caller
+// that's merely quiet for a while doesn't lose its accumulated burst.
+const bucketIdleTTL = 10 * time.Minute
+
+// sweepInterval bounds how often allow() scans buckets for eviction, so the
+// scan cost is amortized across many calls rather than paid on every one.
+const sweepInterval = time.Minute
+
+// RateLimiter is a token-bucket limiter keyed by (caller, method): each key
+// gets its own bucket, refilled at RatePerSecond and capped at Burst.
+// Buckets idle for longer than bucketIdleTTL are evicted so the caller
+// population isn't allowed to grow the map forever.
+type RateLimiter struct {
+	RatePerSecond float64
+	Burst         int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter returns a limiter allowing ratePerSecond sustained calls
+// per (caller, method) key, with bursts of up to burst calls.
+func NewRateLimiter(ratePerSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		RatePerSecond: ratePerSecond,
+		Burst:         burst,
+		buckets:       make(map[string]*tokenBucket),
+	}
+}
+
+func (r *RateLimiter) allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.sweep(now)
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(r.Burst), updated: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(r.Burst), b.tokens+now.Sub(b.updated).Seconds()*r.RatePerSecond)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep evicts buckets idle for longer than bucketIdleTTL, at most once per
+// sweepInterval. Callers must hold r.mu.
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < sweepInterval {
+		return
+	}
+	r.lastSweep = now
+	for key, b := range r.buckets {
+		if now.Sub(b.updated) > bucketIdleTTL {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// UpdateLimits changes the sustained rate and burst size. Existing buckets
+// keep their accumulated tokens; only the refill rate and cap change.
+func (r *RateLimiter) UpdateLimits(ratePerSecond float64, burst int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.RatePerSecond = ratePerSecond
+	r.Burst = burst
+}
+
+// Middleware enforces r, keyed by (caller, ctx.Method). The caller is
+// ctx.Principal.ID when an Authenticator established one, since ctx.CallerUuid
+// alone is taken straight off the wire and unverified: any caller could
+// otherwise defeat the limit entirely by sending a fresh random Uuid on
+// every call. Falls back to ctx.CallerUuid when no Authenticator is
+// configured. Use it as one of Kite.Middlewares, e.g.
+// append(k.Middlewares, limiter.Middleware).
+func (r *RateLimiter) Middleware(ctx *CallContext, next Handler) error {
+	caller := ctx.CallerUuid
+	if ctx.Principal != nil {
+		caller = ctx.Principal.ID
+	}
+	if !r.allow(caller + ":" + ctx.Method) {
+		return ErrRateLimited
+	}
+	return next(ctx)
+}
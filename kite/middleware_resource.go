@@ -0,0 +1,69 @@
+package kite
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// ErrOverloaded is returned by ResourceGuard when the host is above one of
+// its configured thresholds.
+var ErrOverloaded = errors.New("kite: host overloaded")
+
+// ResourceGuard rejects calls while host CPU or memory usage is above
+// configured thresholds. Usage is sampled fresh on every call for each
+// check whose threshold is non-zero, whatever its value; nothing is cached,
+// and only a zero threshold skips the sampling.
+type ResourceGuard struct {
+	mu sync.Mutex
+
+	// maxCPUPercent is the CPU usage percentage (0-100) above which new
+	// calls are rejected. Zero disables the CPU check.
+	maxCPUPercent float64
+
+	// maxMemPercent is the RAM usage percentage (0-100) above which new
+	// calls are rejected. Zero disables the memory check.
+	maxMemPercent float64
+}
+
+// NewResourceGuard returns a guard enforcing maxCPUPercent/maxMemPercent; a
+// zero threshold disables that particular check.
+func NewResourceGuard(maxCPUPercent, maxMemPercent float64) *ResourceGuard {
+	return &ResourceGuard{maxCPUPercent: maxCPUPercent, maxMemPercent: maxMemPercent}
+}
+
+// UpdateThresholds changes the CPU/memory thresholds Middleware enforces on
+// the next call; a threshold of 0 disables that particular check.
+func (g *ResourceGuard) UpdateThresholds(maxCPUPercent, maxMemPercent float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxCPUPercent = maxCPUPercent
+	g.maxMemPercent = maxMemPercent
+}
+
+func (g *ResourceGuard) Middleware(ctx *CallContext, next Handler) error {
+	g.mu.Lock()
+	maxCPUPercent, maxMemPercent := g.maxCPUPercent, g.maxMemPercent
+	g.mu.Unlock()
+
+	if maxCPUPercent > 0 {
+		percents, err := cpu.Percent(0, false)
+		if err == nil && len(percents) > 0 && percents[0] > maxCPUPercent {
+			log.Printf("kite: rejecting %s, cpu at %.1f%% (max %.1f%%)\n", ctx.ServiceMethod, percents[0], maxCPUPercent)
+			return ErrOverloaded
+		}
+	}
+
+	if maxMemPercent > 0 {
+		vm, err := mem.VirtualMemory()
+		if err == nil && vm.UsedPercent > maxMemPercent {
+			log.Printf("kite: rejecting %s, memory at %.1f%% (max %.1f%%)\n", ctx.ServiceMethod, vm.UsedPercent, maxMemPercent)
+			return ErrOverloaded
+		}
+	}
+
+	return next(ctx)
+}
@@ -0,0 +1,61 @@
+// Generated from kite.proto. This tree has no protoc/protoc-gen-go on hand,
+// so Header is hand-maintained to match what protoc-gen-go would emit for
+// the message above; regenerate this file if kite.proto changes.
+
+package proto
+
+import (
+	goproto "code.google.com/p/goprotobuf/proto"
+)
+
+// Header is the wire representation of the Header message in kite.proto.
+type Header struct {
+	ServiceMethod *string `protobuf:"bytes,1,opt,name=service_method" json:"service_method,omitempty"`
+	Seq           *uint64 `protobuf:"varint,2,opt,name=seq" json:"seq,omitempty"`
+	ContentType   *string `protobuf:"bytes,3,opt,name=content_type" json:"content_type,omitempty"`
+	Compression   *string `protobuf:"bytes,4,opt,name=compression" json:"compression,omitempty"`
+	Error         *string `protobuf:"bytes,5,opt,name=error" json:"error,omitempty"`
+}
+
+func (h *Header) Reset()         { *h = Header{} }
+func (h *Header) String() string { return goproto.CompactTextString(h) }
+func (*Header) ProtoMessage()    {}
+
+func (h *Header) GetServiceMethod() string {
+	if h != nil && h.ServiceMethod != nil {
+		return *h.ServiceMethod
+	}
+	return ""
+}
+
+func (h *Header) GetSeq() uint64 {
+	if h != nil && h.Seq != nil {
+		return *h.Seq
+	}
+	return 0
+}
+
+func (h *Header) GetContentType() string {
+	if h != nil && h.ContentType != nil {
+		return *h.ContentType
+	}
+	return ""
+}
+
+func (h *Header) GetCompression() string {
+	if h != nil && h.Compression != nil {
+		return *h.Compression
+	}
+	return ""
+}
+
+func (h *Header) GetError() string {
+	if h != nil && h.Error != nil {
+		return *h.Error
+	}
+	return ""
+}
+
+func init() {
+	goproto.RegisterType((*Header)(nil), "proto.Header")
+}
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/rpc"
+)
+
+// connected is the status line a TCP transport client expects back after
+// issuing an HTTP CONNECT, matching net/rpc's own convention.
+const connected = "200 Connected to Go RPC"
+
+// TCP is the original Kite transport: a plain TCP dial on the client side
+// performing an HTTP CONNECT handshake before handing the connection to the
+// RPC codec, and a plain TCP listener on the server side.
+type TCP struct{}
+
+// NewTCP returns the default, un-encrypted TCP transport.
+func NewTCP() *TCP { return &TCP{} }
+
+func (t *TCP) Name() string { return "tcp" }
+
+func (t *TCP) Dial(addr string) (Conn, error) {
+	conn, err := net.Dial("tcp4", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write([]byte("CONNECT " + rpc.DefaultRPCPath + " HTTP/1.0\n\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "dial-http", Net: "tcp " + addr, Err: err}
+	}
+	if resp.Status != connected {
+		conn.Close()
+		return nil, errors.New("unexpected HTTP response: " + resp.Status)
+	}
+
+	return conn, nil
+}
+
+func (t *TCP) Listen(addr string) (Listener, error) {
+	return wrapListener(net.Listen("tcp4", addr))
+}
@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/rpc"
+)
+
+// TLS wraps TCP with a *tls.Config, enabling mTLS between kites. The
+// handshake otherwise follows the same CONNECT convention as TCP.
+type TLS struct {
+	TCP
+	Config *tls.Config
+}
+
+// NewTLS returns a TLS transport using cfg for both dialing and listening.
+// cfg is typically configured with ClientAuth: tls.RequireAndVerifyClientCert
+// for mutual TLS deployments.
+func NewTLS(cfg *tls.Config) *TLS {
+	return &TLS{Config: cfg}
+}
+
+func (t *TLS) Name() string { return "tls" }
+
+func (t *TLS) Dial(addr string) (Conn, error) {
+	conn, err := tls.Dial("tcp4", addr, t.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write([]byte("CONNECT " + rpc.DefaultRPCPath + " HTTP/1.0\n\n"))
+	var resp *http.Response
+	if err == nil {
+		resp, err = http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	}
+	if err == nil && resp.Status != connected {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (t *TLS) Listen(addr string) (Listener, error) {
+	ln, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	return wrapListener(tls.NewListener(ln, t.Config), nil)
+}
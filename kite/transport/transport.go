@@ -0,0 +1,62 @@
+// Package transport abstracts the wire-level connection a Kite dials out on
+// and listens with, so the RPC and codec layers above it don't need to know
+// whether they're running over plain TCP, TLS or WebSocket.
+package transport
+
+import (
+	"io"
+	"net"
+)
+
+// Conn is the minimal surface the Kite codecs need from an established
+// connection. net.Conn already satisfies it.
+type Conn interface {
+	io.ReadWriteCloser
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// Listener accepts incoming Conns. A net.Listener does not satisfy it
+// directly, since its Accept returns net.Conn; netListener adapts one.
+type Listener interface {
+	Accept() (Conn, error)
+	Close() error
+	Addr() net.Addr
+}
+
+// Transport is implemented by every wire protocol a Kite can be configured
+// to use.
+//
+// Known limitation: Name is only consulted locally (debug logging and
+// serve()'s websocket accept-loop special case) and is not yet part of the
+// kite announcement the way models.Kite.Codec is. dialClient always dials
+// out using the caller's own configured Transport, so every kite that needs
+// to reach every other kite currently has to share the same Transport.
+type Transport interface {
+	// Dial opens an outgoing connection to addr.
+	Dial(addr string) (Conn, error)
+
+	// Listen starts accepting incoming connections on addr.
+	Listen(addr string) (Listener, error)
+
+	// Name identifies the transport, e.g. "tcp", "tls" or "websocket".
+	Name() string
+}
+
+// netListener adapts a net.Listener to the Listener interface by wrapping
+// each accepted net.Conn as-is (net.Conn already satisfies Conn).
+type netListener struct {
+	net.Listener
+}
+
+func (l netListener) Accept() (Conn, error) {
+	return l.Listener.Accept()
+}
+
+// wrapListener is a small helper shared by the TCP and TLS transports.
+func wrapListener(l net.Listener, err error) (Listener, error) {
+	if err != nil {
+		return nil, err
+	}
+	return netListener{l}, nil
+}
@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"net"
+	"net/http"
+)
+
+// WebSocket is a pure WebSocket transport, useful when kites must be
+// deployed behind an HTTP reverse proxy that only forwards HTTP(S) traffic.
+type WebSocket struct {
+	// Origin is sent on outgoing Dial calls, as required by the WebSocket
+	// handshake. Defaults to "http://localhost" if empty.
+	Origin string
+}
+
+// NewWebSocket returns a WebSocket transport using origin for outgoing
+// dials.
+func NewWebSocket(origin string) *WebSocket {
+	return &WebSocket{Origin: origin}
+}
+
+func (w *WebSocket) Name() string { return "websocket" }
+
+func (w *WebSocket) Dial(addr string) (Conn, error) {
+	origin := w.Origin
+	if origin == "" {
+		origin = "http://localhost"
+	}
+	url := "ws://" + addr + "/"
+	return websocket.Dial(url, "", origin)
+}
+
+func (w *WebSocket) Listen(addr string) (Listener, error) {
+	ln, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	wl := &wsListener{
+		ln:     ln,
+		connCh: make(chan Conn),
+		errCh:  make(chan error, 1),
+	}
+
+	server := &http.Server{Handler: websocket.Handler(wl.accept)}
+	go func() {
+		wl.errCh <- server.Serve(ln)
+	}()
+
+	return wl, nil
+}
+
+// wsListener adapts the callback-based websocket.Handler into the pull-based
+// Listener interface by shuttling each accepted connection through a
+// channel.
+type wsListener struct {
+	ln     net.Listener
+	connCh chan Conn
+	errCh  chan error
+}
+
+func (l *wsListener) accept(ws *websocket.Conn) {
+	done := make(chan struct{})
+	l.connCh <- &wsConn{Conn: ws, done: done}
+	// Block the handler goroutine for the lifetime of the connection; once
+	// the codec closes it, websocket.Handler's deferred ws.Close() would
+	// otherwise run immediately and tear the socket down from under it.
+	<-done
+}
+
+// wsConn closes done alongside the underlying connection so the accepting
+// handler goroutine knows it's safe to return.
+type wsConn struct {
+	*websocket.Conn
+	done chan struct{}
+}
+
+func (c *wsConn) Close() error {
+	err := c.Conn.Close()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	return err
+}
+
+func (l *wsListener) Accept() (Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+	case err := <-l.errCh:
+		return nil, err
+	}
+}
+
+func (l *wsListener) Close() error {
+	return l.ln.Close()
+}
+
+func (l *wsListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
@@ -0,0 +1,228 @@
+// Package protocol defines the types a Kite exchanges with Kontrol: the
+// Options it is constructed with, the Request/PubResponse messages sent
+// over the pub/sub channel, and the action/codec constants both sides
+// agree on.
+//
+// protocol imports only the kite/breaker and kite/transport subpackages of
+// koding/newkite: it must not import koding/newkite/kite (which imports
+// protocol for these very types) or
+// koding/db/models (models.Kite embeds Base, so the reverse import would
+// be a cycle too). Any Options field whose natural type lives in one of
+// those packages is declared here as interface{} and type-asserted back
+// in kite.New; see HealthListener and SelfRemediation below.
+package protocol
+
+import (
+	"time"
+
+	"koding/newkite/kite/breaker"
+	"koding/newkite/kite/transport"
+)
+
+// Base carries the fields common to every Kontrol message: who is sending
+// it and where/how to reach them.
+type Base struct {
+	Username  string
+	Kitename  string
+	Version   string
+	Uuid      string
+	PublicKey string
+	Hostname  string
+	Addr      string
+	LocalIP   string
+	PublicIP  string
+	Port      string
+	Token     string
+
+	// Codec is the wire codec the sender serves, e.g. CODEC_GOB or
+	// CODEC_PROTO, announced so a remote kite knows which client codec to
+	// dial with.
+	Codec string
+
+	// Incarnation is bumped by the sender (see kite.ReregisterRemediation)
+	// each time it re-registers believing its prior registration was lost,
+	// so Kontrol and gossip peers that already hold a newer HeartbeatTS for
+	// this Uuid still accept the re-registration as current.
+	Incarnation int
+}
+
+// Request is sent to Kontrol, e.g. to register or to look up peers.
+type Request struct {
+	Base
+	RemoteKite string
+	Action     string
+}
+
+// RegisterResponse is Kontrol's reply to a "register" Request.
+type RegisterResponse struct {
+	Result string
+}
+
+// RegisterResponse.Result values.
+const (
+	AllowKite  = "allow"
+	PermitKite = "permit"
+)
+
+// PubResponse is what Kontrol publishes to registered kites: peer
+// membership changes (AddKite/RemoveKite/UpdateKite) and operator-pushed
+// config updates (Action "updateLimits"; see Kite.UpdateLimits).
+type PubResponse struct {
+	Base
+	Action string
+
+	// RateLimitPerSecond/RateLimitBurst, MaxConcurrentPerMethod,
+	// MaxCPUPercent/MaxMemPercent and BreakerConfig are only read for an
+	// "updateLimits" Action; a zero value leaves the corresponding limit
+	// unchanged.
+	RateLimitPerSecond     float64
+	RateLimitBurst         int
+	MaxConcurrentPerMethod int
+	MaxCPUPercent          float64
+	MaxMemPercent          float64
+	BreakerConfig          breaker.Config
+}
+
+// PubResponse/Request Action values for peer membership changes.
+const (
+	AddKite    = "addKite"
+	RemoveKite = "removeKite"
+	UpdateKite = "updateKite"
+)
+
+// KiteRequest is the envelope every RPC call carries, regardless of wire
+// codec.
+type KiteRequest struct {
+	Base
+	Args   interface{}
+	Origin string
+}
+
+// Origin values, announced so the serving kite knows which client codec
+// the caller dialed with.
+const (
+	ORIGIN_GOB   = "gob"
+	ORIGIN_PROTO = "proto"
+)
+
+// Codec values for Base.Codec/Options.Codec.
+const (
+	CODEC_GOB   = "gob"
+	CODEC_PROTO = "proto"
+)
+
+// WEBSOCKET_PATH is the HTTP path ServeHTTP routes to the WebSocket
+// handler.
+const WEBSOCKET_PATH = "/subscribe"
+
+// Options configures a Kite at construction time, normally parsed from
+// manifest.json but also constructible in code for tests.
+type Options struct {
+	Username string
+	Kitename string
+	Version  string
+	Port     string
+	LocalIP  string
+	PublicIP string
+
+	// SeedAddrs bootstraps the gossip membership view; see Kite.SeedAddrs.
+	SeedAddrs []string
+
+	// GossipAddr overrides the address the gossip listener binds to; see
+	// Kite.GossipAddr.
+	GossipAddr string
+
+	// Transport overrides the wire transport a Kite dials out on and
+	// listens with; see Kite.Transport.
+	Transport transport.Transport
+
+	// Codec selects the wire codec a Kite serves and announces to Kontrol
+	// at registration, e.g. CODEC_GOB (the default) or CODEC_PROTO; see
+	// Kite.Codec.
+	Codec string
+
+	// Authenticator and Authorizer configure per-call authentication and
+	// authorization; see Kite.Authenticator/Kite.Authorizer. Declared here
+	// (rather than as kite.Authenticator/kite.Authorizer) so Options can
+	// hold them without protocol importing kite; kite.Authenticator and
+	// kite.Authorizer are aliases of these same types.
+	Authenticator Authenticator
+	Authorizer    Authorizer
+
+	// RateLimitPerSecond/RateLimitBurst configure Kite.RateLimiter; zero
+	// disables rate limiting.
+	RateLimitPerSecond float64
+	RateLimitBurst     int
+
+	// MaxConcurrentPerMethod configures Kite.ConcurrencyLimiter; zero
+	// disables the concurrency limit.
+	MaxConcurrentPerMethod int
+
+	// MaxCPUPercent/MaxMemPercent configure Kite.ResourceGuard; zero
+	// disables the corresponding check.
+	MaxCPUPercent float64
+	MaxMemPercent float64
+
+	// BreakerConfig tunes the outbound circuit breaker shared by all
+	// peers; the zero value keeps breaker.DefaultConfig().
+	BreakerConfig breaker.Config
+
+	// HealthCheckInterval/HealthCheckTimeout/HealthCheckFailureThreshold
+	// configure Kite.HealthCheckConfig; a zero Interval and
+	// FailureThreshold leaves health checking disabled.
+	HealthCheckInterval         time.Duration
+	HealthCheckTimeout          time.Duration
+	HealthCheckFailureThreshold int
+
+	// HealthListener, if set, must be a kite.HealthListener
+	// (func(*models.Kite, bool)). It is declared as interface{} and
+	// type-asserted back in kite.New rather than typed directly, since
+	// models.Kite embeds Base and protocol importing koding/db/models
+	// back would be a cycle.
+	HealthListener interface{}
+
+	// SelfWatchdogInterval/SelfWatchdogMissedIntervals configure
+	// Kite.SelfWatchdog; a zero Interval leaves the self-watchdog
+	// disabled.
+	SelfWatchdogInterval        time.Duration
+	SelfWatchdogMissedIntervals int
+
+	// SelfRemediation, if set, must be a kite.SelfRemediation
+	// (func(*kite.Kite)). Declared as interface{} for the same
+	// import-cycle reason as HealthListener.
+	SelfRemediation interface{}
+}
+
+// Authenticator establishes who is making a request. It is consulted once
+// per incoming call, before Authorizer and before the registered method
+// runs.
+type Authenticator interface {
+	Authenticate(req *KiteRequest) (Principal, error)
+}
+
+// Authorizer decides whether an already-authenticated Principal may invoke
+// method on kitename.
+type Authorizer interface {
+	Authorize(p Principal, kitename, method string) error
+}
+
+// Principal is whatever an Authenticator was able to establish about the
+// caller of an incoming request.
+type Principal struct {
+	// ID identifies the caller, e.g. the Uuid of the calling kite.
+	ID string
+
+	// Roles are consulted by Authorizer implementations such as
+	// ACLAuthorizer.
+	Roles []string
+}
+
+// HasRole reports whether p was granted role, e.g. "role:admin".
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}